@@ -3,6 +3,8 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 )
@@ -12,6 +14,18 @@ type PluginSettings struct {
 	Headers         map[string]string     `json:"headers,omitempty"`
 	QueryParameters map[string]string     `json:"queryParameters,omitempty"`
 	Secrets         *SecretPluginSettings `json:"-"`
+
+	// Reconnect/keepalive tuning, all in milliseconds. Zero means "use the
+	// datasource's default".
+	ReconnectMinBackoffMs int `json:"reconnectMinBackoffMs,omitempty"`
+	ReconnectMaxBackoffMs int `json:"reconnectMaxBackoffMs,omitempty"`
+	PingIntervalMs        int `json:"pingIntervalMs,omitempty"`
+
+	// AllowPublish opts into forwarding Grafana PublishStream messages
+	// upstream. PublishAllowPattern must also match a message's raw JSON
+	// body for it to be forwarded; an empty pattern denies everything.
+	AllowPublish        bool   `json:"allowPublish,omitempty"`
+	PublishAllowPattern string `json:"publishAllowPattern,omitempty"`
 }
 
 type SecretPluginSettings struct {
@@ -28,10 +42,15 @@ func LoadPluginSettings(source backend.DataSourceInstanceSettings) (*PluginSetti
 	}
 
 	settings := &PluginSettings{
-		Path:            toString(raw["path"]),
-		Headers:         map[string]string{},
-		QueryParameters: map[string]string{},
-		Secrets:         loadSecretPluginSettings(source.DecryptedSecureJSONData),
+		Path:                  toString(raw["path"]),
+		Headers:               map[string]string{},
+		QueryParameters:       map[string]string{},
+		Secrets:               loadSecretPluginSettings(source.DecryptedSecureJSONData),
+		ReconnectMinBackoffMs: toInt(raw["reconnectMinBackoffMs"]),
+		ReconnectMaxBackoffMs: toInt(raw["reconnectMaxBackoffMs"]),
+		PingIntervalMs:        toInt(raw["pingIntervalMs"]),
+		AllowPublish:          toBool(raw["allowPublish"]),
+		PublishAllowPattern:   toString(raw["publishAllowPattern"]),
 	}
 
 	// Prefer structured headers/queryParameters if provided
@@ -70,6 +89,25 @@ func LoadPluginSettings(source backend.DataSourceInstanceSettings) (*PluginSetti
 	return settings, nil
 }
 
+// MissingValues returns the names of any headers/query parameters that
+// resolved to an empty value, which happens when a legacy headerName*/
+// queryParamName* entry points at a secret that was never set.
+func (s *PluginSettings) MissingValues() []string {
+	var missing []string
+	for name, value := range s.Headers {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+	for name, value := range s.QueryParameters {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
 func loadSecretPluginSettings(source map[string]string) *SecretPluginSettings {
 	return &SecretPluginSettings{
 		ApiKey: source["apiKey"],
@@ -118,6 +156,30 @@ func splitOnName(setting string) []string {
 	return []string{setting}
 }
 
+func toInt(v any) int {
+	switch t := v.(type) {
+	case float64:
+		return int(t)
+	case string:
+		n, _ := strconv.Atoi(t)
+		return n
+	default:
+		return 0
+	}
+}
+
+func toBool(v any) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		b, _ := strconv.ParseBool(t)
+		return b
+	default:
+		return false
+	}
+}
+
 func toString(v any) string {
 	if v == nil {
 		return ""
@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+)
+
+// tracer emits spans for the upstream dial and frame-delivery steps of a
+// stream, linked to the incoming RunStreamRequest's trace context, so
+// Grafana -> plugin -> upstream WS -> panel latency shows up as one trace.
+var tracer = otel.Tracer("github.com/grafana/grafana-starter-datasource-backend")
+
+// Metrics are all labeled by datasource UID and channel path. They are
+// registered against prometheus.DefaultRegisterer in init, which backs the
+// plugin SDK's own /metrics endpoint, so they show up there without any
+// extra wiring.
+var (
+	messagesReceivedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_messages_received_total",
+		Help: "Number of websocket messages received from the upstream server.",
+	}, []string{"datasource_uid", "channel"})
+
+	reconnectsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_reconnects_total",
+		Help: "Number of times a stream's upstream websocket connection was re-dialed.",
+	}, []string{"datasource_uid", "channel"})
+
+	streamErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_stream_errors_total",
+		Help: "Number of stream-level errors, labeled by reason.",
+	}, []string{"datasource_uid", "channel", "reason"})
+
+	messageBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "websocket_message_bytes",
+		Help:    "Size in bytes of messages received from the upstream server.",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+	}, []string{"datasource_uid", "channel"})
+
+	dialDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "websocket_dial_duration_seconds",
+		Help:    "Time taken to establish (or re-establish) the upstream websocket connection.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"datasource_uid", "channel"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		messagesReceivedTotal,
+		reconnectsTotal,
+		streamErrorsTotal,
+		messageBytes,
+		dialDurationSeconds,
+	)
+}
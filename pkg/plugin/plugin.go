@@ -4,15 +4,31 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"path"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana-plugin-sdk-go/live"
 	"github.com/grafana/grafana-starter-datasource-backend/pkg/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Defaults applied when the corresponding PluginSettings field is zero.
+const (
+	defaultReconnectMinBackoff = 500 * time.Millisecond
+	defaultReconnectMaxBackoff = 30 * time.Second
+	defaultPingInterval        = 30 * time.Second
 )
 
 // Make sure WebSocketDataSource implements required interfaces. This is important to do
@@ -31,9 +47,22 @@ var (
 	_ instancemgmt.InstanceDisposer = (*WebSocketDataSource)(nil)
 )
 
+// channelConfig carries everything a wsDataProxy needs to (re)establish a
+// stream for a given live.Channel path. protocol selects the proxy mode;
+// the graphql* fields are only used when protocol is one of the graphql-ws
+// variants, and the jsonrpc* fields only when it is "jsonrpc".
 type channelConfig struct {
-	path        string
-	queryParams map[string]string
+	path                 string
+	queryParams          map[string]string
+	protocol             string
+	graphqlQuery         string
+	graphqlVariables     map[string]interface{}
+	graphqlOperationName string
+	jsonrpcMethod        string
+	jsonrpcParams        interface{}
+	jsonrpcResultPath    string
+	fields               []messageField
+	arrayPath            string
 }
 
 // NewWebSocketDataSource creates a new datasource instance.
@@ -43,19 +72,48 @@ func NewWebSocketDataSource(_ context.Context, ds backend.DataSourceInstanceSett
 		return nil, fmt.Errorf("failed to read CustomSettings from the Query Request: %s", err.Error())
 	}
 
+	var publishAllowPattern *regexp.Regexp
+	if settings.AllowPublish && settings.PublishAllowPattern != "" {
+		publishAllowPattern, err = regexp.Compile(settings.PublishAllowPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid publishAllowPattern: %s", err.Error())
+		}
+	}
+
 	return &WebSocketDataSource{
 		customHeaders:         settings.Headers,
 		customQueryParameters: settings.QueryParameters,
 		channelConfigs:        map[string]channelConfig{},
+		streamProxies:         map[string]*wsDataProxy{},
+		secrets:               settings.Secrets,
+		reconnectMinBackoff:   durationOrDefault(settings.ReconnectMinBackoffMs, defaultReconnectMinBackoff),
+		reconnectMaxBackoff:   durationOrDefault(settings.ReconnectMaxBackoffMs, defaultReconnectMaxBackoff),
+		pingInterval:          durationOrDefault(settings.PingIntervalMs, defaultPingInterval),
+		allowPublish:          settings.AllowPublish,
+		publishAllowPattern:   publishAllowPattern,
 	}, nil
 }
 
+func durationOrDefault(ms int, def time.Duration) time.Duration {
+	if ms <= 0 {
+		return def
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
 // WebSocketDataSource is an example datasource which can respond to data queries, reports
 // its health and has streaming skills.
 type WebSocketDataSource struct {
 	customHeaders         map[string]string
 	customQueryParameters map[string]string
 	channelConfigs        map[string]channelConfig
+	streamProxies         map[string]*wsDataProxy
+	secrets               *models.SecretPluginSettings
+	reconnectMinBackoff   time.Duration
+	reconnectMaxBackoff   time.Duration
+	pingInterval          time.Duration
+	allowPublish          bool
+	publishAllowPattern   *regexp.Regexp
 	mu                    sync.RWMutex
 }
 
@@ -72,6 +130,11 @@ func (wsds *WebSocketDataSource) Dispose() {
 // The QueryDataResponse contains a map of RefID to the response for each query, and each response
 // contains Frames ([]*Frame).
 func (wsds *WebSocketDataSource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+	ctx, span := tracer.Start(ctx, "QueryData", trace.WithAttributes(
+		attribute.String("datasource_uid", req.PluginContext.DataSourceInstanceSettings.UID),
+	))
+	defer span.End()
+
 	// create response struct
 	response := backend.NewQueryDataResponse()
 
@@ -90,6 +153,37 @@ func (wsds *WebSocketDataSource) QueryData(ctx context.Context, req *backend.Que
 type queryModel struct {
 	WsPath      string            `json:"path"`
 	QueryParams map[string]string `json:"queryParams"`
+
+	// Protocol selects the wsDataProxy mode. Empty means the default
+	// raw-passthrough mode. "graphql-transport-ws" and "graphql-ws" run a
+	// GraphQL subscription over the respective subprotocol. "jsonrpc" runs
+	// a JSON-RPC 2.0 subscribe/notify exchange (e.g. eth_subscribe).
+	Protocol      string                 `json:"protocol"`
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+
+	Method     string      `json:"method"`
+	Params     interface{} `json:"params"`
+	ResultPath string      `json:"resultPath"`
+
+	// Fields, when set, turns each incoming raw-passthrough message into a
+	// typed data.Frame row instead of the single raw "data" string: each
+	// entry names a field and a path to extract its value from the decoded
+	// message. ArrayPath additionally treats the value at that path as an
+	// array of records, each producing one row.
+	Fields    []messageField `json:"fields"`
+	ArrayPath string         `json:"arrayPath"`
+}
+
+// messageField names one field to extract from a decoded websocket message.
+// Path is a dot/bracket path such as "result.price" or "data.ticks[0].ts".
+// Type is one of "number", "string", "bool" or "time"; it defaults to
+// "string" when empty.
+type messageField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Path string `json:"path"`
 }
 
 func (wsds *WebSocketDataSource) query(_ context.Context, pCtx backend.PluginContext, query backend.DataQuery) backend.DataResponse {
@@ -116,65 +210,102 @@ func (wsds *WebSocketDataSource) query(_ context.Context, pCtx backend.PluginCon
 	frame.SetMeta(&data.FrameMeta{Channel: channel.String()})
 	// add the frames to the response.
 	response.Frames = append(response.Frames, frame)
-	wsds.setChannelConfig(channel.Path, qm.WsPath, wsds.mergeQueryParams(qm.QueryParams))
+	wsds.setChannelConfig(channel.Path, channelConfig{
+		path:                 qm.WsPath,
+		queryParams:          wsds.mergeQueryParams(qm.QueryParams),
+		protocol:             qm.Protocol,
+		graphqlQuery:         qm.Query,
+		graphqlVariables:     qm.Variables,
+		graphqlOperationName: qm.OperationName,
+		jsonrpcMethod:        qm.Method,
+		jsonrpcParams:        qm.Params,
+		jsonrpcResultPath:    qm.ResultPath,
+		fields:               qm.Fields,
+		arrayPath:            qm.ArrayPath,
+	})
 
 	return response
 }
 
+// checkHealthTimeout bounds how long CheckHealth waits for the WebSocket
+// handshake before reporting the datasource as unreachable.
+const checkHealthTimeout = 5 * time.Second
+
 // CheckHealth handles health checks sent from Grafana to the plugin.
 // The main use case for these health checks is the test button on the
 // datasource configuration page which allows users to verify that
-// a datasource is working as expected.
+// a datasource is working as expected. It performs a real WebSocket
+// handshake against the configured URL, reusing the same header/query
+// merging logic RunStream uses.
 func (wsds *WebSocketDataSource) CheckHealth(_ context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
 	log.DefaultLogger.Info("CheckHealth called", "request", req)
 
-	var status = backend.HealthStatusOk
-	var message = "Data source is working"
-
-	// var jsonData map[string]string
-	// if err := json.Unmarshal(req.PluginContext.AppInstanceSettings.JSONData, &jsonData); err != nil {
-	// 	log.DefaultLogger.Error("Health Check", "Unmarshall JsonData check", err.Error())
-	// 	return &backend.CheckHealthResult{
-	// 		Status:  backend.HealthStatusError,
-	// 		Message: err.Error(),
-	// 	}, err
-	// }
-
-	// checkHost := func(host string) error {
-	// 	_, err := url.Parse(host)
-	// 	log.DefaultLogger.Error("Health Check func", "host check func", err.Error())
-	// 	if err != nil {
-	// 		return fmt.Errorf("host is not valid: %s", err.Error())
-	// 	}
-	// 	return nil
-	// }
-
-	// // if err := checkHost(string(jsonData["host"])); err != nil {
-	// if err := checkHost("tes.com"); err != nil {
-	// 	log.DefaultLogger.Error("Health Check", "host check", err.Error())
-	// 	return &backend.CheckHealthResult{
-	// 		Status:  backend.HealthStatusError,
-	// 		Message: err.Error(),
-	// 	}, err
-	// }
-
-	// else if err := checkCustomHeaders(); err != nil {
-	// 	status = backend.HealthStatusError
-	// 	message = err.Error()
-	// } else if err := checkCustomQueryParameters(); err != nil {
-	// 	status = backend.HealthStatusError
-	// 	message = err.Error()
-	// }
+	settings, err := models.LoadPluginSettings(*req.PluginContext.DataSourceInstanceSettings)
+	if err != nil {
+		return &backend.CheckHealthResult{
+			Status:  backend.HealthStatusError,
+			Message: fmt.Sprintf("failed to read datasource settings: %s", err.Error()),
+		}, nil
+	}
+
+	if missing := settings.MissingValues(); len(missing) > 0 {
+		return &backend.CheckHealthResult{
+			Status:  backend.HealthStatusError,
+			Message: fmt.Sprintf("missing value(s) for: %s", strings.Join(missing, ", ")),
+		}, nil
+	}
+
+	wsUrl, err := url.Parse(req.PluginContext.DataSourceInstanceSettings.URL)
+	if err != nil {
+		return &backend.CheckHealthResult{
+			Status:  backend.HealthStatusError,
+			Message: fmt.Sprintf("invalid URL: %s", err.Error()),
+		}, nil
+	}
+	if wsUrl.Scheme != "ws" && wsUrl.Scheme != "wss" {
+		return &backend.CheckHealthResult{
+			Status:  backend.HealthStatusError,
+			Message: fmt.Sprintf("URL scheme must be ws or wss, got %q", wsUrl.Scheme),
+		}, nil
+	}
+
+	wsUrl.Path = path.Join(wsUrl.Path, settings.Path)
+	queryParams := url.Values{}
+	for qpName, qpValue := range wsds.mergeQueryParams(settings.QueryParameters) {
+		queryParams.Add(qpName, qpValue)
+	}
+	wsUrl.RawQuery = queryParams.Encode()
+
+	headers := http.Header{}
+	for headerName, headerValue := range settings.Headers {
+		headers.Add(headerName, headerValue)
+	}
+
+	dialer := &websocket.Dialer{HandshakeTimeout: checkHealthTimeout}
+	conn, err := dialWebSocket(dialer, wsUrl.String(), headers)
+	if err != nil {
+		return &backend.CheckHealthResult{
+			Status:  backend.HealthStatusError,
+			Message: err.Error(),
+		}, nil
+	}
+	conn.Close()
 
 	return &backend.CheckHealthResult{
-		Status:  status,
-		Message: message,
+		Status:  backend.HealthStatusOk,
+		Message: "Data source is working",
 	}, nil
 }
 
 // SubscribeStream is called when a client wants to connect to a stream. This callback
 // allows sending the first message.
-func (wsds *WebSocketDataSource) SubscribeStream(_ context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+func (wsds *WebSocketDataSource) SubscribeStream(ctx context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	_, span := tracer.Start(ctx, "SubscribeStream", trace.WithAttributes(
+		attribute.String("datasource_uid", req.PluginContext.DataSourceInstanceSettings.UID),
+		attribute.String("channel", req.Path),
+	))
+	defer span.End()
+
 	status := backend.SubscribeStreamStatusOK
 
 	return &backend.SubscribeStreamResponse{
@@ -187,53 +318,90 @@ func (wsds *WebSocketDataSource) SubscribeStream(_ context.Context, req *backend
 func (wsds *WebSocketDataSource) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
 	log.DefaultLogger.Info("RunStream called", "Path", req.Path)
 
+	ctx, span := tracer.Start(ctx, "RunStream", trace.WithAttributes(
+		attribute.String("datasource_uid", req.PluginContext.DataSourceInstanceSettings.UID),
+		attribute.String("channel", req.Path),
+	))
+	defer span.End()
+
 	cfg, ok := wsds.getChannelConfig(req.Path)
 	if !ok {
 		err := fmt.Errorf("no channel config found for %s", req.Path)
 		log.DefaultLogger.Error("RunStream config missing", "path", req.Path, "error", err)
+		streamErrorsTotal.WithLabelValues(req.PluginContext.DataSourceInstanceSettings.UID, req.Path, "config_missing").Inc()
 		sendErrorFrame(err.Error(), sender)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
-	wsDataProxy, err := NewWsDataProxy(req, sender, wsds, cfg)
+	wsDataProxy, err := NewWsDataProxy(ctx, req, sender, wsds, cfg)
 	if err != nil {
 		errCtx := "Starting WebSocket"
 
 		log.DefaultLogger.Error(errCtx, "error", err.Error())
 
+		streamErrorsTotal.WithLabelValues(req.PluginContext.DataSourceInstanceSettings.UID, req.Path, "dial_failed").Inc()
 		sendErrorFrame(fmt.Sprintf("%s: %s", errCtx, err.Error()), sender)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 
 		return err
 	}
 
+	wsds.setStreamProxy(req.Path, wsDataProxy)
+	defer wsds.clearStreamProxy(req.Path)
+
 	go wsDataProxy.proxyMessage()
 
 	go wsDataProxy.readMessage()
 
+	go wsDataProxy.keepalive()
+
 	select {
 	case <-ctx.Done():
 
-		wsDataProxy.done <- true
+		wsDataProxy.closeSubscriptions()
+		wsDataProxy.close()
 
 		log.DefaultLogger.Info("Closing Channel", "channel", req.Path)
 
 		return nil
-	case rError := <-wsDataProxy.readingErrors:
-		log.DefaultLogger.Error("Error reading the websocket", "error", err.Error())
-		sendErrorFrame(fmt.Sprintf("%s: %s", "Error reading the websocket", err.Error()), sender)
+	case <-wsDataProxy.streamDone:
+
+		wsDataProxy.close()
 
-		log.DefaultLogger.Info("Closing Channel due an error to read websocket", "channel", req.Path)
+		log.DefaultLogger.Info("Closing Channel, upstream subscription completed", "channel", req.Path)
 
-		return rError
+		return nil
 	}
 }
 
-// PublishStream is called when a client sends a message to the stream.
+// PublishStream is called when a client sends a message to the stream. When
+// allowPublish is enabled and the message matches the configured allow-list,
+// it is forwarded upstream on the same connection RunStream opened for this
+// channel.
 func (wsds *WebSocketDataSource) PublishStream(_ context.Context, req *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
-	// Do not allow publishing at all.
-	return &backend.PublishStreamResponse{
-		Status: backend.PublishStreamStatusPermissionDenied,
-	}, nil
+	if !wsds.allowPublish {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+	}
+
+	if wsds.publishAllowPattern == nil || !wsds.publishAllowPattern.Match(req.Data) {
+		log.DefaultLogger.Warn("Rejected publish: message did not match the allow-list", "channel", req.Path)
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+	}
+
+	proxy, ok := wsds.getStreamProxy(req.Path)
+	if !ok {
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusNotFound}, nil
+	}
+
+	if err := proxy.writeMessage(websocket.TextMessage, req.Data); err != nil {
+		log.DefaultLogger.Error("Failed to forward published message upstream", "channel", req.Path, "error", err)
+		return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, err
+	}
+
+	return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusOK}, nil
 }
 
 func (wsds *WebSocketDataSource) mergeQueryParams(queryParams map[string]string) map[string]string {
@@ -247,13 +415,10 @@ func (wsds *WebSocketDataSource) mergeQueryParams(queryParams map[string]string)
 	return merged
 }
 
-func (wsds *WebSocketDataSource) setChannelConfig(channelPath string, basePath string, params map[string]string) {
+func (wsds *WebSocketDataSource) setChannelConfig(channelPath string, cfg channelConfig) {
 	wsds.mu.Lock()
 	defer wsds.mu.Unlock()
-	wsds.channelConfigs[channelPath] = channelConfig{
-		path:        basePath,
-		queryParams: params,
-	}
+	wsds.channelConfigs[channelPath] = cfg
 }
 
 func (wsds *WebSocketDataSource) getChannelConfig(channelPath string) (channelConfig, bool) {
@@ -262,3 +427,24 @@ func (wsds *WebSocketDataSource) getChannelConfig(channelPath string) (channelCo
 	cfg, ok := wsds.channelConfigs[channelPath]
 	return cfg, ok
 }
+
+// setStreamProxy registers the wsDataProxy currently open for channelPath so
+// PublishStream can look it up and forward messages upstream.
+func (wsds *WebSocketDataSource) setStreamProxy(channelPath string, proxy *wsDataProxy) {
+	wsds.mu.Lock()
+	defer wsds.mu.Unlock()
+	wsds.streamProxies[channelPath] = proxy
+}
+
+func (wsds *WebSocketDataSource) clearStreamProxy(channelPath string) {
+	wsds.mu.Lock()
+	defer wsds.mu.Unlock()
+	delete(wsds.streamProxies, channelPath)
+}
+
+func (wsds *WebSocketDataSource) getStreamProxy(channelPath string) (*wsDataProxy, bool) {
+	wsds.mu.RLock()
+	defer wsds.mu.RUnlock()
+	proxy, ok := wsds.streamProxies[channelPath]
+	return proxy, ok
+}
@@ -1,42 +1,94 @@
 package plugin
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Subprotocols/modes supported by wsDataProxy.
+const (
+	protocolGraphQLTransportWS = "graphql-transport-ws"
+	protocolGraphQLWS          = "graphql-ws"
+	protocolJSONRPC            = "jsonrpc"
+)
+
+// handshakeReadTimeout bounds the protocol handshake/subscribe reads below
+// (the GraphQL connection_ack and the JSON-RPC subscribe response). These
+// run before any user message has arrived, so they can't rely on
+// configureKeepalive's read deadline, which is not armed at all when the
+// data source's pingInterval is zero.
+const handshakeReadTimeout = 10 * time.Second
+
 type wsDataProxy struct {
-	wsUrl         string
-	wsConn        *websocket.Conn
-	msgRead       chan []byte
-	sender        *backend.StreamSender
-	done          chan bool
-	wsDataSource  *WebSocketDataSource
-	readingErrors chan error
-	path          string
-	queryParams   map[string]string
-}
-
-func NewWsDataProxy(req *backend.RunStreamRequest, sender *backend.StreamSender, ds *WebSocketDataSource, cfg channelConfig) (*wsDataProxy, error) {
+	wsUrl        string
+	msgRead      chan []byte
+	sender       *backend.StreamSender
+	done         chan struct{}
+	closeOnce    sync.Once
+	streamDone   chan struct{}
+	wsDataSource *WebSocketDataSource
+	cfg          channelConfig
+	req          *backend.RunStreamRequest
+
+	// rootCtx carries the trace context of the RunStreamRequest that opened
+	// this proxy. wsConnect and sendFrame start their spans as children of
+	// it so the whole stream's telemetry links back to the request that
+	// started it.
+	rootCtx context.Context
+	// dsUID and channelPath label every metric this proxy emits.
+	dsUID       string
+	channelPath string
+
+	// connMu guards wsConn, which is replaced on every reconnect. readMessage
+	// is the only goroutine that ever writes it; keepalive and the
+	// subscription helpers only read it.
+	connMu sync.RWMutex
+	wsConn *websocket.Conn
+
+	// writeMu serializes writes to wsConn: gorilla/websocket forbids
+	// concurrent writers, and keepalive pings, handshake/subscribe messages
+	// and PublishStream forwarding can all write at once.
+	writeMu sync.Mutex
+
+	// jsonrpc protocol state: the subscription IDs this proxy owns, and the
+	// next request id to use. One physical socket may eventually carry more
+	// than one Grafana subscription, so access is mutex-guarded.
+	jsonrpcMu     sync.Mutex
+	jsonrpcNextID int64
+	jsonrpcSubIDs map[string]bool
+}
+
+func NewWsDataProxy(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender, ds *WebSocketDataSource, cfg channelConfig) (*wsDataProxy, error) {
 	wsDataProxy := &wsDataProxy{
-		msgRead:       make(chan []byte),
-		sender:        sender,
-		done:          make(chan bool, 1),
-		wsDataSource:  ds,
-		readingErrors: make(chan error),
-		path:          cfg.path,
-		queryParams:   cfg.queryParams,
+		msgRead:      make(chan []byte),
+		sender:       sender,
+		done:         make(chan struct{}),
+		streamDone:   make(chan struct{}),
+		wsDataSource: ds,
+		cfg:          cfg,
+		req:          req,
+		rootCtx:      ctx,
+		dsUID:        req.PluginContext.DataSourceInstanceSettings.UID,
+		channelPath:  req.Path,
 	}
 
 	url, err := wsDataProxy.encodeURL(req)
@@ -49,39 +101,230 @@ func NewWsDataProxy(req *backend.RunStreamRequest, sender *backend.StreamSender,
 	if err != nil {
 		return nil, fmt.Errorf("connection Error: %s", err.Error())
 	}
-	wsDataProxy.wsConn = c
+	wsDataProxy.setConn(c)
+	wsDataProxy.configureKeepalive(c)
+
+	if isGraphQLProtocol(cfg.protocol) {
+		if err := wsDataProxy.graphqlHandshake(req); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("graphql handshake error: %s", err.Error())
+		}
+	}
+
+	if cfg.protocol == protocolJSONRPC {
+		wsDataProxy.jsonrpcSubIDs = map[string]bool{}
+		if err := wsDataProxy.jsonrpcSubscribe(); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("jsonrpc subscribe error: %s", err.Error())
+		}
+	}
+
+	// The handshake/subscribe reads above arm their own handshakeReadTimeout
+	// deadline; re-arm the keepalive deadline now that it's done, or a
+	// quiet-but-healthy upstream would hit a spurious timeout in readMessage
+	// well before the first keepalive ping has a chance to renew it.
+	wsDataProxy.configureKeepalive(c)
 
 	return wsDataProxy, nil
 }
 
+func (wsdp *wsDataProxy) getConn() *websocket.Conn {
+	wsdp.connMu.RLock()
+	defer wsdp.connMu.RUnlock()
+	return wsdp.wsConn
+}
+
+func (wsdp *wsDataProxy) setConn(c *websocket.Conn) {
+	wsdp.connMu.Lock()
+	wsdp.wsConn = c
+	wsdp.connMu.Unlock()
+}
+
+// writeMessage sends a raw frame on the current connection. Used by
+// PublishStream to forward a Grafana-published message upstream.
+func (wsdp *wsDataProxy) writeMessage(messageType int, data []byte) error {
+	wsdp.writeMu.Lock()
+	defer wsdp.writeMu.Unlock()
+	return wsdp.getConn().WriteMessage(messageType, data)
+}
+
+func (wsdp *wsDataProxy) writeJSON(v interface{}) error {
+	wsdp.writeMu.Lock()
+	defer wsdp.writeMu.Unlock()
+	return wsdp.getConn().WriteJSON(v)
+}
+
+func (wsdp *wsDataProxy) writeControl(messageType int, data []byte, deadline time.Time) error {
+	wsdp.writeMu.Lock()
+	defer wsdp.writeMu.Unlock()
+	return wsdp.getConn().WriteControl(messageType, data, deadline)
+}
+
+// close signals every goroutine owned by this proxy (readMessage, keepalive)
+// to stop. It is safe to call more than once.
+func (wsdp *wsDataProxy) close() {
+	wsdp.closeOnce.Do(func() {
+		close(wsdp.done)
+	})
+}
+
+func isGraphQLProtocol(protocol string) bool {
+	return protocol == protocolGraphQLTransportWS || protocol == protocolGraphQLWS
+}
+
 func (wsdp *wsDataProxy) readMessage() {
 	defer func() {
-		wsdp.wsConn.Close()
+		wsdp.getConn().Close()
 		close(wsdp.msgRead)
 		log.DefaultLogger.Info("Read Message routine", "detail", "closing websocket connection and msgRead channel")
 	}()
 
+	backoff := wsdp.wsDataSource.reconnectMinBackoff
+
 	for {
 		select {
 		case <-wsdp.done:
 			return
 		default:
-			_, message, err := wsdp.wsConn.ReadMessage()
-			if err != nil {
-				time.Sleep(3 * time.Second)
-				wsdp.readingErrors <- fmt.Errorf("%s: %s", "Error reading the websocket", err.Error())
-				return
-			} else {
-				wsdp.msgRead <- message
+		}
+
+		_, message, err := wsdp.getConn().ReadMessage()
+		if err == nil {
+			backoff = wsdp.wsDataSource.reconnectMinBackoff
+			messagesReceivedTotal.WithLabelValues(wsdp.dsUID, wsdp.channelPath).Inc()
+			messageBytes.WithLabelValues(wsdp.dsUID, wsdp.channelPath).Observe(float64(len(message)))
+			wsdp.msgRead <- message
+			continue
+		}
+
+		log.DefaultLogger.Warn("Error reading the websocket, reconnecting", "error", err)
+		streamErrorsTotal.WithLabelValues(wsdp.dsUID, wsdp.channelPath, "read_error").Inc()
+		wsdp.getConn().Close()
+		sendStatusFrame(fmt.Sprintf("websocket disconnected, reconnecting: %s", err.Error()), wsdp.sender)
+
+		if !wsdp.waitForReconnect(backoff) {
+			return
+		}
+
+		if err := wsdp.reconnect(); err != nil {
+			log.DefaultLogger.Warn("Reconnect attempt failed", "error", err)
+			streamErrorsTotal.WithLabelValues(wsdp.dsUID, wsdp.channelPath, "reconnect_failed").Inc()
+			backoff = nextBackoff(backoff, wsdp.wsDataSource.reconnectMaxBackoff)
+			continue
+		}
+
+		backoff = wsdp.wsDataSource.reconnectMinBackoff
+		sendStatusFrame("websocket reconnected", wsdp.sender)
+	}
+}
+
+// waitForReconnect sleeps for backoff plus jitter, returning false if the
+// proxy was told to shut down while waiting.
+func (wsdp *wsDataProxy) waitForReconnect(backoff time.Duration) bool {
+	wait := backoff + jitter(backoff)
+	select {
+	case <-wsdp.done:
+		return false
+	case <-time.After(wait):
+		return true
+	}
+}
+
+// jitter returns a random duration in [0, d/2], used to avoid reconnect
+// storms when many streams drop at once.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)/2 + 1))
+}
+
+// nextBackoff doubles the current backoff, capped at max.
+func nextBackoff(current, max time.Duration) time.Duration {
+	next := current * 2
+	if next > max {
+		return max
+	}
+	return next
+}
+
+// reconnect redials the upstream endpoint and replays whichever
+// handshake/subscribe messages this channel's protocol requires.
+func (wsdp *wsDataProxy) reconnect() error {
+	reconnectsTotal.WithLabelValues(wsdp.dsUID, wsdp.channelPath).Inc()
+
+	conn, err := wsdp.wsConnect()
+	if err != nil {
+		return err
+	}
+	wsdp.setConn(conn)
+	wsdp.configureKeepalive(conn)
+
+	switch {
+	case isGraphQLProtocol(wsdp.cfg.protocol):
+		if err := wsdp.graphqlHandshake(wsdp.req); err != nil {
+			conn.Close()
+			return err
+		}
+	case wsdp.cfg.protocol == protocolJSONRPC:
+		wsdp.jsonrpcMu.Lock()
+		wsdp.jsonrpcSubIDs = map[string]bool{}
+		wsdp.jsonrpcMu.Unlock()
+		if err := wsdp.jsonrpcSubscribe(); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	// Re-arm the keepalive deadline now that the handshake is done; see the
+	// matching call in NewWsDataProxy for why.
+	wsdp.configureKeepalive(conn)
+
+	return nil
+}
+
+// configureKeepalive arms the read deadline and pong handler for a freshly
+// dialed connection, or clears any deadline already on the connection (e.g.
+// the handshakeReadTimeout armed by graphqlHandshake/jsonrpcSubscribe) when
+// no ping interval is configured.
+func (wsdp *wsDataProxy) configureKeepalive(conn *websocket.Conn) {
+	interval := wsdp.wsDataSource.pingInterval
+	if interval <= 0 {
+		conn.SetReadDeadline(time.Time{})
+		return
+	}
+
+	deadline := 2 * interval
+	conn.SetReadDeadline(time.Now().Add(deadline))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(deadline))
+	})
+}
+
+// keepalive periodically pings the current connection so that a half-open
+// TCP connection is detected quickly, rather than waiting on a TCP timeout.
+func (wsdp *wsDataProxy) keepalive() {
+	interval := wsdp.wsDataSource.pingInterval
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-wsdp.done:
+			return
+		case <-ticker.C:
+			if err := wsdp.writeControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+				log.DefaultLogger.Warn("Failed to send websocket ping", "error", err)
 			}
 		}
 	}
 }
 
 func (wsdp *wsDataProxy) proxyMessage() {
-	frame := data.NewFrame("response")
-	m := make(map[string]interface{})
-
 	for {
 		message, ok := <-wsdp.msgRead
 		// if channel was closed
@@ -89,18 +332,552 @@ func (wsdp *wsDataProxy) proxyMessage() {
 			return
 		}
 
-		json.Unmarshal(message, &m)
+		switch {
+		case isGraphQLProtocol(wsdp.cfg.protocol):
+			wsdp.handleGraphQLMessage(message)
+		case wsdp.cfg.protocol == protocolJSONRPC:
+			wsdp.handleJSONRPCMessage(message)
+		default:
+			wsdp.handleRawMessage(message)
+		}
+	}
+}
 
+// handleRawMessage is the default passthrough behavior: with no fields
+// configured, every frame is wrapped as a single "data" field holding the
+// raw message string. With fields configured, it decodes the message and
+// extracts each one instead; see sendStructuredMessage.
+func (wsdp *wsDataProxy) handleRawMessage(message []byte) {
+	if len(wsdp.cfg.fields) == 0 {
+		frame := data.NewFrame("response")
 		frame.Fields = append(frame.Fields, data.NewField("data", nil, []string{string(message)}))
 
-		err := wsdp.sender.SendFrame(frame, data.IncludeAll)
+		wsdp.sendFrame(frame)
+		return
+	}
+
+	wsdp.sendStructuredMessage(message)
+}
+
+// sendStructuredMessage decodes message once and evaluates every configured
+// field's path against it to build a typed data.Frame. When arrayPath is
+// set, the value at that path is treated as an array of records and each
+// one produces a row; otherwise the whole message is a single record and
+// produces a single row. Decode and path errors are sent as an error frame
+// rather than dropped.
+func (wsdp *wsDataProxy) sendStructuredMessage(message []byte) {
+	var doc interface{}
+	if err := json.Unmarshal(message, &doc); err != nil {
+		sendErrorFrame(fmt.Sprintf("failed to decode message: %s", err.Error()), wsdp.sender)
+		return
+	}
+
+	records := []interface{}{doc}
+	if wsdp.cfg.arrayPath != "" {
+		arr, ok := navigatePath(doc, wsdp.cfg.arrayPath)
+		if !ok {
+			sendErrorFrame(fmt.Sprintf("arrayPath %q not found in message", wsdp.cfg.arrayPath), wsdp.sender)
+			return
+		}
+		items, ok := arr.([]interface{})
+		if !ok {
+			sendErrorFrame(fmt.Sprintf("arrayPath %q did not resolve to an array", wsdp.cfg.arrayPath), wsdp.sender)
+			return
+		}
+		records = items
+	}
+
+	frame := data.NewFrame("response")
+	for _, spec := range wsdp.cfg.fields {
+		values := make([]interface{}, len(records))
+		for i, record := range records {
+			raw, ok := navigatePath(record, spec.Path)
+			if !ok {
+				sendErrorFrame(fmt.Sprintf("field %q: path %q not found in message", spec.Name, spec.Path), wsdp.sender)
+				return
+			}
+			typed, err := convertFieldValue(spec.Type, raw)
+			if err != nil {
+				sendErrorFrame(fmt.Sprintf("field %q: %s", spec.Name, err.Error()), wsdp.sender)
+				return
+			}
+			values[i] = typed
+		}
+
+		field, err := newTypedColumn(spec.Name, spec.Type, values)
 		if err != nil {
-			log.DefaultLogger.Error("Failed to send frame", "error", err)
+			sendErrorFrame(err.Error(), wsdp.sender)
+			return
+		}
+		frame.Fields = append(frame.Fields, field)
+	}
+
+	wsdp.sendFrame(frame)
+}
+
+// convertFieldValue coerces a decoded JSON leaf to the Go type matching
+// typ ("number", "bool", "time", or "string"/"" for the default).
+func convertFieldValue(typ string, v interface{}) (interface{}, error) {
+	switch typ {
+	case "number":
+		switch t := v.(type) {
+		case float64:
+			return t, nil
+		case string:
+			f, err := strconv.ParseFloat(t, 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected a number, got %q", t)
+			}
+			return f, nil
+		default:
+			return nil, fmt.Errorf("expected a number, got %T", v)
+		}
+	case "bool":
+		switch t := v.(type) {
+		case bool:
+			return t, nil
+		case string:
+			b, err := strconv.ParseBool(t)
+			if err != nil {
+				return nil, fmt.Errorf("expected a bool, got %q", t)
+			}
+			return b, nil
+		default:
+			return nil, fmt.Errorf("expected a bool, got %T", v)
+		}
+	case "time":
+		switch t := v.(type) {
+		case string:
+			ts, err := time.Parse(time.RFC3339, t)
+			if err != nil {
+				return nil, fmt.Errorf("expected an RFC3339 timestamp, got %q", t)
+			}
+			return ts, nil
+		case float64:
+			return time.UnixMilli(int64(t)), nil
+		default:
+			return nil, fmt.Errorf("expected a time, got %T", v)
+		}
+	default:
+		switch t := v.(type) {
+		case string:
+			return t, nil
+		case nil:
+			return "", nil
+		default:
+			b, _ := json.Marshal(t)
+			return string(b), nil
+		}
+	}
+}
+
+// newTypedColumn builds a data.Field of the Go type matching typ from
+// values already converted by convertFieldValue.
+func newTypedColumn(name, typ string, values []interface{}) (*data.Field, error) {
+	switch typ {
+	case "number":
+		out := make([]float64, len(values))
+		for i, v := range values {
+			out[i] = v.(float64)
+		}
+		return data.NewField(name, nil, out), nil
+	case "bool":
+		out := make([]bool, len(values))
+		for i, v := range values {
+			out[i] = v.(bool)
+		}
+		return data.NewField(name, nil, out), nil
+	case "time":
+		out := make([]time.Time, len(values))
+		for i, v := range values {
+			out[i] = v.(time.Time)
+		}
+		return data.NewField(name, nil, out), nil
+	default:
+		out := make([]string, len(values))
+		for i, v := range values {
+			out[i] = v.(string)
+		}
+		return data.NewField(name, nil, out), nil
+	}
+}
+
+// graphqlMessage is the envelope shared by graphql-transport-ws and the
+// legacy graphql-ws protocol (connection_init/ack, subscribe/start,
+// next/data, error, complete).
+type graphqlMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// graphqlHandshake runs the connection_init/connection_ack exchange and then
+// starts the subscription for this channel's query. It is called
+// synchronously from NewWsDataProxy, before readMessage/proxyMessage are
+// started, and from reconnect inside readMessage, so no other goroutine
+// reads the socket meanwhile and it can read it directly.
+func (wsdp *wsDataProxy) graphqlHandshake(req *backend.RunStreamRequest) error {
+	conn := wsdp.getConn()
+
+	authPayload := map[string]interface{}{}
+	if secrets := wsdp.wsDataSource.secrets; secrets != nil && secrets.ApiKey != "" {
+		authPayload["apiKey"] = secrets.ApiKey
+	}
+	initPayload, err := json.Marshal(authPayload)
+	if err != nil {
+		return fmt.Errorf("failed to encode connection_init payload: %s", err.Error())
+	}
+
+	if err := wsdp.writeJSON(graphqlMessage{Type: "connection_init", Payload: initPayload}); err != nil {
+		return fmt.Errorf("failed to send connection_init: %s", err.Error())
+	}
+
+waitForAck:
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(handshakeReadTimeout)); err != nil {
+			return fmt.Errorf("failed to arm handshake read deadline: %s", err.Error())
+		}
+		var ack graphqlMessage
+		if err := conn.ReadJSON(&ack); err != nil {
+			return fmt.Errorf("failed waiting for connection_ack: %s", err.Error())
+		}
+		switch ack.Type {
+		case "connection_ack":
+			break waitForAck
+		case "connection_error", "error":
+			return fmt.Errorf("server rejected connection_init: %s", string(ack.Payload))
+		}
+	}
+
+	subscribePayload := map[string]interface{}{"query": wsdp.cfg.graphqlQuery}
+	if wsdp.cfg.graphqlVariables != nil {
+		subscribePayload["variables"] = wsdp.cfg.graphqlVariables
+	}
+	if wsdp.cfg.graphqlOperationName != "" {
+		subscribePayload["operationName"] = wsdp.cfg.graphqlOperationName
+	}
+	payload, err := json.Marshal(subscribePayload)
+	if err != nil {
+		return fmt.Errorf("failed to encode subscribe payload: %s", err.Error())
+	}
+
+	subscribeType := "subscribe"
+	if wsdp.cfg.protocol == protocolGraphQLWS {
+		subscribeType = "start"
+	}
+
+	msg := graphqlMessage{ID: path.Base(req.Path), Type: subscribeType, Payload: payload}
+	if err := wsdp.writeJSON(msg); err != nil {
+		return fmt.Errorf("failed to send %s: %s", subscribeType, err.Error())
+	}
+
+	return nil
+}
+
+// handleGraphQLMessage decodes one graphql-ws/graphql-transport-ws frame and
+// either forwards payload.data as a typed data.Frame, surfaces an error
+// frame, or closes the stream on "complete".
+func (wsdp *wsDataProxy) handleGraphQLMessage(message []byte) {
+	var msg graphqlMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		sendErrorFrame(fmt.Sprintf("graphql: failed to decode message: %s", err.Error()), wsdp.sender)
+		return
+	}
+
+	switch msg.Type {
+	case "next", "data":
+		wsdp.sendGraphQLData(msg.Payload)
+	case "error":
+		sendErrorFrame(fmt.Sprintf("graphql: subscription error: %s", string(msg.Payload)), wsdp.sender)
+	case "complete":
+		log.DefaultLogger.Info("GraphQL subscription complete", "id", msg.ID)
+		close(wsdp.streamDone)
+	}
+}
+
+func (wsdp *wsDataProxy) sendGraphQLData(rawPayload json.RawMessage) {
+	var payload struct {
+		Data   json.RawMessage `json:"data"`
+		Errors json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(rawPayload, &payload); err != nil {
+		sendErrorFrame(fmt.Sprintf("graphql: failed to decode payload: %s", err.Error()), wsdp.sender)
+		return
+	}
+	if len(payload.Errors) > 0 {
+		sendErrorFrame(fmt.Sprintf("graphql: subscription returned errors: %s", string(payload.Errors)), wsdp.sender)
+		return
+	}
+
+	var payloadData map[string]interface{}
+	if err := json.Unmarshal(payload.Data, &payloadData); err != nil {
+		sendErrorFrame(fmt.Sprintf("graphql: failed to decode data: %s", err.Error()), wsdp.sender)
+		return
+	}
+
+	flat := map[string]interface{}{}
+	flattenJSON("", payloadData, flat)
+
+	frame := data.NewFrame("response")
+	for _, name := range sortedKeys(flat) {
+		frame.Fields = append(frame.Fields, data.NewField(name, nil, fieldValue(flat[name])))
+	}
+
+	wsdp.sendFrame(frame)
+}
+
+// jsonrpcRequest is a JSON-RPC 2.0 request envelope.
+type jsonrpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// jsonrpcSubscribe sends the configured subscribe call (e.g. eth_subscribe),
+// waits for its response and records the returned subscription id. It is
+// called synchronously from NewWsDataProxy, before readMessage/proxyMessage
+// are started, and from reconnect inside readMessage, so no other goroutine
+// reads the socket meanwhile and it can read it directly.
+func (wsdp *wsDataProxy) jsonrpcSubscribe() error {
+	conn := wsdp.getConn()
+
+	wsdp.jsonrpcMu.Lock()
+	wsdp.jsonrpcNextID++
+	id := wsdp.jsonrpcNextID
+	wsdp.jsonrpcMu.Unlock()
+
+	req := jsonrpcRequest{JSONRPC: "2.0", ID: id, Method: wsdp.cfg.jsonrpcMethod, Params: wsdp.cfg.jsonrpcParams}
+	if err := wsdp.writeJSON(req); err != nil {
+		return fmt.Errorf("failed to send %s: %s", wsdp.cfg.jsonrpcMethod, err.Error())
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(handshakeReadTimeout)); err != nil {
+		return fmt.Errorf("failed to arm handshake read deadline: %s", err.Error())
+	}
+
+	var resp struct {
+		ID     int64           `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := conn.ReadJSON(&resp); err != nil {
+		return fmt.Errorf("failed waiting for %s response: %s", wsdp.cfg.jsonrpcMethod, err.Error())
+	}
+	if len(resp.Error) > 0 {
+		return fmt.Errorf("server rejected %s: %s", wsdp.cfg.jsonrpcMethod, string(resp.Error))
+	}
+
+	var subID string
+	if err := json.Unmarshal(resp.Result, &subID); err != nil {
+		return fmt.Errorf("expected a subscription id string in the %s result: %s", wsdp.cfg.jsonrpcMethod, err.Error())
+	}
+
+	wsdp.jsonrpcMu.Lock()
+	wsdp.jsonrpcSubIDs[subID] = true
+	wsdp.jsonrpcMu.Unlock()
+
+	return nil
+}
+
+// closeSubscriptions issues the matching *_unsubscribe call for every
+// subscription this proxy owns. It is best-effort: it is called right
+// before the underlying connection is torn down, so write errors are only
+// logged.
+func (wsdp *wsDataProxy) closeSubscriptions() {
+	if wsdp.cfg.protocol != protocolJSONRPC {
+		return
+	}
+
+	unsubscribeMethod := jsonrpcUnsubscribeMethod(wsdp.cfg.jsonrpcMethod)
+
+	wsdp.jsonrpcMu.Lock()
+	subIDs := make([]string, 0, len(wsdp.jsonrpcSubIDs))
+	for subID := range wsdp.jsonrpcSubIDs {
+		subIDs = append(subIDs, subID)
+	}
+	wsdp.jsonrpcMu.Unlock()
+
+	for _, subID := range subIDs {
+		wsdp.jsonrpcMu.Lock()
+		wsdp.jsonrpcNextID++
+		id := wsdp.jsonrpcNextID
+		wsdp.jsonrpcMu.Unlock()
+
+		req := jsonrpcRequest{JSONRPC: "2.0", ID: id, Method: unsubscribeMethod, Params: []string{subID}}
+		if err := wsdp.writeJSON(req); err != nil {
+			log.DefaultLogger.Warn("Failed to send jsonrpc unsubscribe", "method", unsubscribeMethod, "error", err)
+		}
+	}
+}
+
+// jsonrpcUnsubscribeMethod derives the unsubscribe call from a subscribe
+// call name, e.g. "eth_subscribe" -> "eth_unsubscribe".
+func jsonrpcUnsubscribeMethod(subscribeMethod string) string {
+	if strings.HasSuffix(subscribeMethod, "_subscribe") {
+		return strings.TrimSuffix(subscribeMethod, "_subscribe") + "_unsubscribe"
+	}
+	return strings.Replace(subscribeMethod, "subscribe", "unsubscribe", 1)
+}
+
+// handleJSONRPCMessage routes an inbound frame to SendFrame if it is a
+// notification for one of this proxy's own subscriptions; anything else
+// (responses, notifications for other subscriptions) is dropped.
+func (wsdp *wsDataProxy) handleJSONRPCMessage(message []byte) {
+	var notif struct {
+		Method string `json:"method"`
+		Params struct {
+			Subscription string          `json:"subscription"`
+			Result       json.RawMessage `json:"result"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(message, &notif); err != nil {
+		log.DefaultLogger.Debug("Dropping non-JSON-RPC frame", "error", err)
+		return
+	}
+	if notif.Params.Subscription == "" {
+		return
+	}
+
+	wsdp.jsonrpcMu.Lock()
+	owned := wsdp.jsonrpcSubIDs[notif.Params.Subscription]
+	wsdp.jsonrpcMu.Unlock()
+	if !owned {
+		return
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(notif.Params.Result, &result); err != nil {
+		sendErrorFrame(fmt.Sprintf("jsonrpc: failed to decode result: %s", err.Error()), wsdp.sender)
+		return
+	}
+
+	value := result
+	fieldName := "result"
+	if wsdp.cfg.jsonrpcResultPath != "" {
+		extracted, ok := navigatePath(result, wsdp.cfg.jsonrpcResultPath)
+		if !ok {
+			sendErrorFrame(fmt.Sprintf("jsonrpc: resultPath %q not found in notification", wsdp.cfg.jsonrpcResultPath), wsdp.sender)
+			return
+		}
+		value = extracted
+		fieldName = lastPathSegment(wsdp.cfg.jsonrpcResultPath)
+	}
+
+	frame := data.NewFrame("response")
+	frame.Fields = append(frame.Fields, data.NewField(fieldName, nil, fieldValue(value)))
+	wsdp.sendFrame(frame)
+}
+
+// navigatePath resolves a dot/bracket path such as "result.price" or
+// "ticks[0].ts" against a decoded JSON document.
+func navigatePath(v interface{}, pathStr string) (interface{}, bool) {
+	pathStr = strings.TrimPrefix(pathStr, "$.")
+	pathStr = strings.TrimPrefix(pathStr, "$")
+	if pathStr == "" {
+		return v, true
+	}
+
+	cur := v
+	for _, segment := range strings.Split(pathStr, ".") {
+		name, idx, hasIdx := splitPathSegment(segment)
+		if name != "" {
+			m, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			cur, ok = m[name]
+			if !ok {
+				return nil, false
+			}
+		}
+		if hasIdx {
+			arr, ok := cur.([]interface{})
+			if !ok || idx < 0 || idx >= len(arr) {
+				return nil, false
+			}
+			cur = arr[idx]
+		}
+	}
+	return cur, true
+}
+
+// splitPathSegment splits a single path segment like "ticks[0]" into its
+// field name and, if present, array index.
+func splitPathSegment(segment string) (name string, idx int, hasIdx bool) {
+	open := strings.Index(segment, "[")
+	if open < 0 || !strings.HasSuffix(segment, "]") {
+		return segment, 0, false
+	}
+	name = segment[:open]
+	n, err := strconv.Atoi(segment[open+1 : len(segment)-1])
+	if err != nil {
+		return segment, 0, false
+	}
+	return name, n, true
+}
+
+// lastPathSegment returns the trailing field name of a navigatePath path,
+// used to name the resulting data.Field.
+func lastPathSegment(pathStr string) string {
+	pathStr = strings.TrimPrefix(pathStr, "$.")
+	pathStr = strings.TrimPrefix(pathStr, "$")
+	segments := strings.Split(pathStr, ".")
+	last := segments[len(segments)-1]
+	if idx := strings.Index(last, "["); idx >= 0 {
+		last = last[:idx]
+	}
+	return last
+}
+
+// flattenJSON walks a decoded JSON document and writes every leaf value into
+// out, keyed by its dot/bracket path (e.g. "result.price", "ticks[0].ts").
+func flattenJSON(prefix string, v interface{}, out map[string]interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenJSON(key, val, out)
 		}
-		frame.Fields = make([]*data.Field, 0)
+	case []interface{}:
+		for i, val := range t {
+			flattenJSON(fmt.Sprintf("%s[%d]", prefix, i), val, out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+// fieldValue converts a single decoded JSON leaf into the single-row typed
+// slice data.NewField expects.
+func fieldValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case float64:
+		return []float64{t}
+	case string:
+		return []string{t}
+	case bool:
+		return []bool{t}
+	case nil:
+		return []string{""}
+	default:
+		b, _ := json.Marshal(t)
+		return []string{string(b)}
 	}
 }
 
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // encodeURL is hard coded with some variables like scheme and x-api-key but will be definetly refactored after changes in the config editor
 func (wsdp *wsDataProxy) encodeURL(req *backend.RunStreamRequest) (string, error) {
 	host := req.PluginContext.DataSourceInstanceSettings.URL
@@ -110,11 +887,11 @@ func (wsdp *wsDataProxy) encodeURL(req *backend.RunStreamRequest) (string, error
 		return "", fmt.Errorf("failed to parse host string from the Plugin's Config Editor: %s", err.Error())
 	}
 
-	wsUrl.Path = path.Join(wsUrl.Path, wsdp.path)
+	wsUrl.Path = path.Join(wsUrl.Path, wsdp.cfg.path)
 
 	queryParams := url.Values{}
 	// add all query parameters to the URL
-	for qpName, qpValue := range wsdp.queryParams {
+	for qpName, qpValue := range wsdp.cfg.queryParams {
 		queryParams.Add(qpName, qpValue)
 	}
 	wsUrl.RawQuery = queryParams.Encode()
@@ -125,12 +902,42 @@ func (wsdp *wsDataProxy) encodeURL(req *backend.RunStreamRequest) (string, error
 func (wsdp *wsDataProxy) wsConnect() (*websocket.Conn, error) {
 	log.DefaultLogger.Info("Ws Connect", "connecting to", wsdp.wsUrl)
 
+	_, span := tracer.Start(wsdp.rootCtx, "wsConnect", trace.WithAttributes(
+		attribute.String("datasource_uid", wsdp.dsUID),
+		attribute.String("channel", wsdp.channelPath),
+	))
+	defer span.End()
+	start := time.Now()
+
 	customHeaders := http.Header{}
 	for headerName, headerValue := range wsdp.wsDataSource.customHeaders {
 		customHeaders.Add(headerName, headerValue)
 	}
 
-	c, resp, err := websocket.DefaultDialer.Dial(wsdp.wsUrl, customHeaders)
+	dialer := websocket.DefaultDialer
+	if isGraphQLProtocol(wsdp.cfg.protocol) {
+		graphqlDialer := *websocket.DefaultDialer
+		graphqlDialer.Subprotocols = []string{wsdp.cfg.protocol}
+		dialer = &graphqlDialer
+	}
+
+	c, err := dialWebSocket(dialer, wsdp.wsUrl, customHeaders)
+	dialDurationSeconds.WithLabelValues(wsdp.dsUID, wsdp.channelPath).Observe(time.Since(start).Seconds())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	log.DefaultLogger.Info("Ws Connect", "connected to", wsdp.wsUrl)
+
+	return c, nil
+}
+
+// dialWebSocket dials url with dialer and, on failure, folds the handshake
+// response's status and truncated body into the returned error so callers
+// (wsConnect, CheckHealth) don't have to repeat that formatting.
+func dialWebSocket(dialer *websocket.Dialer, url string, headers http.Header) (*websocket.Conn, error) {
+	c, resp, err := dialer.Dial(url, headers)
 	if err != nil {
 		msg := err.Error()
 		if resp != nil {
@@ -147,11 +954,38 @@ func (wsdp *wsDataProxy) wsConnect() (*websocket.Conn, error) {
 		}
 		return nil, fmt.Errorf("websocket dial failed: %s", msg)
 	}
-	log.DefaultLogger.Info("Ws Connect", "connected to", wsdp.wsUrl)
-
 	return c, nil
 }
 
+// sendFrame wraps sender.SendFrame in a span linked to the stream's root
+// trace context, so frame-delivery latency shows up in the same trace as
+// wsConnect and the RunStreamRequest that started the stream.
+func (wsdp *wsDataProxy) sendFrame(frame *data.Frame) {
+	_, span := tracer.Start(wsdp.rootCtx, "SendFrame", trace.WithAttributes(
+		attribute.String("datasource_uid", wsdp.dsUID),
+		attribute.String("channel", wsdp.channelPath),
+	))
+	defer span.End()
+
+	if err := wsdp.sender.SendFrame(frame, data.IncludeAll); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.DefaultLogger.Error("Failed to send frame", "error", err)
+	}
+}
+
+// sendStatusFrame reports transport-level events (e.g. a reconnect) that
+// aren't errors but that dashboards may want to surface as a gap/annotation.
+func sendStatusFrame(msg string, sender *backend.StreamSender) {
+	frame := data.NewFrame("status")
+	frame.Fields = append(frame.Fields, data.NewField("status", nil, []string{msg}))
+
+	serr := sender.SendFrame(frame, data.IncludeAll)
+	if serr != nil {
+		log.DefaultLogger.Error("Failed to send status frame", "error", serr)
+	}
+}
+
 func sendErrorFrame(msg string, sender *backend.StreamSender) {
 	frame := data.NewFrame("error")
 	frame.Fields = append(frame.Fields, data.NewField("error", nil, []string{msg}))
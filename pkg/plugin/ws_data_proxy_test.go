@@ -0,0 +1,176 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestReconnectResubscribesJSONRPC exercises the reconnect path added for
+// jsonrpc channels against a fake upstream that drops the connection right
+// after answering the subscribe call. It asserts that a read on the proxy's
+// connection fails after the drop, and that reconnect then redials and
+// replays the subscribe handshake rather than leaving the stream silently
+// dead.
+func TestReconnectResubscribesJSONRPC(t *testing.T) {
+	var subscribes int32
+	upgrader := websocket.Upgrader{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var req jsonrpcRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		atomic.AddInt32(&subscribes, 1)
+		_ = conn.WriteJSON(map[string]interface{}{"id": req.ID, "result": "sub-1"})
+		// Fall out of the handler (closing the connection) instead of
+		// serving any data frames, simulating an upstream drop mid-stream.
+	}))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	wsdp := &wsDataProxy{
+		done: make(chan struct{}),
+		wsDataSource: &WebSocketDataSource{
+			reconnectMinBackoff: time.Millisecond,
+			reconnectMaxBackoff: 5 * time.Millisecond,
+		},
+		cfg: channelConfig{
+			protocol:      protocolJSONRPC,
+			jsonrpcMethod: "eth_subscribe",
+		},
+		rootCtx:       context.Background(),
+		wsUrl:         wsURL,
+		jsonrpcSubIDs: map[string]bool{},
+	}
+
+	conn, err := wsdp.wsConnect()
+	if err != nil {
+		t.Fatalf("initial dial failed: %v", err)
+	}
+	wsdp.setConn(conn)
+	if err := wsdp.jsonrpcSubscribe(); err != nil {
+		t.Fatalf("initial subscribe failed: %v", err)
+	}
+	if got := atomic.LoadInt32(&subscribes); got != 1 {
+		t.Fatalf("expected 1 subscribe after initial connect, got %d", got)
+	}
+
+	// The server already closed its side after responding; reading again
+	// surfaces that as an error, the same way readMessage would notice a
+	// drop mid-stream.
+	_ = wsdp.getConn().SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := wsdp.getConn().ReadMessage(); err == nil {
+		t.Fatal("expected the dropped connection to surface a read error")
+	}
+
+	if err := wsdp.reconnect(); err != nil {
+		t.Fatalf("reconnect failed: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&subscribes); got != 2 {
+		t.Fatalf("expected reconnect to replay the subscribe handshake, got %d subscribe calls", got)
+	}
+}
+
+// TestKeepaliveSurvivesQuietPeriodAfterHandshake runs readMessage and
+// keepalive together, as RunStream does, against an upstream that answers
+// the subscribe handshake and then pushes no data for longer than
+// handshakeReadTimeout. The handshake arms that 10s deadline on the
+// connection; if it is never re-armed to the keepalive deadline afterwards
+// and no pong renews it first, a quiet-but-healthy connection times out and
+// triggers a spurious reconnect. With the 300ms ping interval used here the
+// pong handler also renews the deadline, so this asserts that the
+// connection survives a quiet period with keepalive running.
+func TestKeepaliveSurvivesQuietPeriodAfterHandshake(t *testing.T) {
+	var subscribes int32
+	var connections int32
+	upgrader := websocket.Upgrader{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		atomic.AddInt32(&connections, 1)
+
+		var req jsonrpcRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		atomic.AddInt32(&subscribes, 1)
+		_ = conn.WriteJSON(map[string]interface{}{"id": req.ID, "result": "sub-1"})
+
+		// Push no data frames, but keep reading so gorilla/websocket's
+		// default ping handler can answer the client's keepalive pings.
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	wsdp := &wsDataProxy{
+		msgRead:    make(chan []byte),
+		done:       make(chan struct{}),
+		streamDone: make(chan struct{}),
+		wsDataSource: &WebSocketDataSource{
+			reconnectMinBackoff: time.Millisecond,
+			reconnectMaxBackoff: 5 * time.Millisecond,
+			pingInterval:        300 * time.Millisecond,
+		},
+		cfg: channelConfig{
+			protocol:      protocolJSONRPC,
+			jsonrpcMethod: "eth_subscribe",
+		},
+		rootCtx:       context.Background(),
+		wsUrl:         wsURL,
+		jsonrpcSubIDs: map[string]bool{},
+	}
+
+	conn, err := wsdp.wsConnect()
+	if err != nil {
+		t.Fatalf("initial dial failed: %v", err)
+	}
+	wsdp.setConn(conn)
+	wsdp.configureKeepalive(conn)
+	if err := wsdp.jsonrpcSubscribe(); err != nil {
+		t.Fatalf("initial subscribe failed: %v", err)
+	}
+	// Mirrors the re-arm NewWsDataProxy does once the handshake is done.
+	wsdp.configureKeepalive(conn)
+
+	go wsdp.readMessage()
+	go wsdp.keepalive()
+	go func() {
+		for range wsdp.msgRead {
+		}
+	}()
+	defer close(wsdp.done)
+
+	time.Sleep(handshakeReadTimeout + 2*time.Second)
+
+	if got := atomic.LoadInt32(&subscribes); got != 1 {
+		t.Fatalf("expected no reconnect/resubscribe during a quiet-but-healthy period, got %d subscribe calls", got)
+	}
+	if got := atomic.LoadInt32(&connections); got != 1 {
+		t.Fatalf("expected a single connection to survive the quiet period, got %d", got)
+	}
+}